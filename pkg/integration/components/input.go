@@ -1,8 +1,9 @@
 package components
 
 import (
+	"encoding/json"
 	"fmt"
-	"strings"
+	"os"
 	"time"
 
 	"github.com/jesseduffield/lazygit/pkg/config"
@@ -15,15 +16,35 @@ type Input struct {
 	keys         config.KeybindingConfig
 	assert       *Assert
 	pushKeyDelay int
+	recorder     *recorder
+	retryTimeout time.Duration
 }
 
+// default timeout for PressUntil (overridable per-test via SetRetryTimeout), and its fixed backoff bounds
+const defaultRetryTimeout = 4 * time.Second
+const (
+	retryInitialDelay = 10 * time.Millisecond
+	retryMaxDelay     = 200 * time.Millisecond
+)
+
+// recordInputEnvVar names the environment variable holding the path to record every
+// press/Wait/semantic action to, for Replay later
+const recordInputEnvVar = "LAZYGIT_RECORD_INPUT"
+
 func NewInput(gui integrationTypes.GuiDriver, keys config.KeybindingConfig, assert *Assert, pushKeyDelay int) *Input {
-	return &Input{
+	input := &Input{
 		gui:          gui,
 		keys:         keys,
 		assert:       assert,
 		pushKeyDelay: pushKeyDelay,
+		retryTimeout: defaultRetryTimeout,
 	}
+
+	if path := os.Getenv(recordInputEnvVar); path != "" {
+		input.recorder = newRecorder(path)
+	}
+
+	return input
 }
 
 // key is something like 'w' or '<space>'. It's best not to pass a direct value,
@@ -34,20 +55,125 @@ func (self *Input) Press(keyStrs ...string) {
 	}
 }
 
+// SetRetryTimeout overrides how long PressUntil will poll its condition before failing,
+// for tests whose post-press state takes longer than usual to settle.
+func (self *Input) SetRetryTimeout(timeout time.Duration) {
+	self.retryTimeout = timeout
+}
+
+// PressUntil presses keyStr, then polls cond with exponential backoff instead of sleeping a
+// fixed pushKeyDelay, until it reports success or self.retryTimeout elapses.
+func (self *Input) PressUntil(keyStr string, cond func() (bool, string)) {
+	if self.recorder != nil {
+		self.recorder.add(RecordedEvent{Kind: recordedEventPress, Key: keyStr})
+	}
+
+	self.gui.PressKey(keyStr)
+
+	delay := retryInitialDelay
+	deadline := time.Now().Add(self.retryTimeout)
+
+	for {
+		ok, message := cond()
+		if ok {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			self.assert.Fail(fmt.Sprintf("PressUntil(%q) timed out after %s: %s", keyStr, self.retryTimeout, message))
+			return
+		}
+
+		self.Wait(int(delay / time.Millisecond))
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
 func (self *Input) press(keyStr string) {
 	self.Wait(self.pushKeyDelay)
 
+	if self.recorder != nil {
+		self.recorder.add(RecordedEvent{Kind: recordedEventPress, Key: keyStr})
+	}
+
 	self.gui.PressKey(keyStr)
 }
 
+// recordSemantic records that a higher-level helper was called, so Replay can call it again
+func (self *Input) recordSemantic(event RecordedEvent) {
+	if self.recorder != nil {
+		event.Kind = recordedEventAssert
+		self.recorder.add(event)
+	}
+}
+
+// FinishRecording does a final flush of the script to the path named by LAZYGIT_RECORD_INPUT,
+// returning any write error. It's a no-op if recording wasn't enabled.
+func (self *Input) FinishRecording() error {
+	if self.recorder == nil {
+		return nil
+	}
+
+	return self.recorder.flush()
+}
+
+// Replay re-executes a script previously produced by a recording session
+func (self *Input) Replay(scriptPath string) error {
+	content, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return err
+	}
+
+	var script RecordedScript
+	if err := json.Unmarshal(content, &script); err != nil {
+		return err
+	}
+
+	for _, event := range script.Events {
+		switch event.Kind {
+		case recordedEventPress:
+			self.gui.PressKey(event.Key)
+		case recordedEventWait:
+			self.Wait(event.WaitMs)
+		case recordedEventAssert:
+			self.replaySemantic(event)
+		}
+	}
+
+	return nil
+}
+
+// replaySemantic calls back into the Input helper named by event.Semantic.
+func (self *Input) replaySemantic(event RecordedEvent) {
+	switch event.Semantic {
+	case semanticNavigateToListItem:
+		self.NavigateToListItem(Contains(event.MatcherText))
+	case semanticNavigateToNthMatch:
+		self.NavigateToNthMatch(Contains(event.MatcherText), event.N)
+	case semanticMenu:
+		self.Menu(Contains(event.TitleText), Contains(event.MatcherText))
+	case semanticPrompt:
+		self.Prompt(Contains(event.TitleText), event.Text)
+	}
+}
+
 func (self *Input) SwitchToStatusWindow() {
 	self.press(self.keys.Universal.JumpToBlock[0])
 	self.assert.CurrentWindowName("status")
 }
 
 func (self *Input) SwitchToFilesWindow() {
-	self.press(self.keys.Universal.JumpToBlock[1])
-	self.assert.CurrentWindowName("files")
+	self.PressUntil(self.keys.Universal.JumpToBlock[1], func() (bool, string) {
+		windowName := self.gui.CurrentContext().GetWindowName()
+		if windowName == "files" {
+			return true, ""
+		}
+		return false, fmt.Sprintf("Expected window 'files', got '%s'", windowName)
+	})
 }
 
 func (self *Input) SwitchToBranchesWindow() {
@@ -102,8 +228,13 @@ func (self *Input) PreviousItem() {
 }
 
 func (self *Input) ContinueMerge() {
-	self.Press(self.keys.Universal.CreateRebaseOptionsMenu)
-	self.assert.SelectedLine(Contains("continue"))
+	self.PressUntil(self.keys.Universal.CreateRebaseOptionsMenu, func() (bool, string) {
+		ok, _ := Contains("continue").test(selectedLineContent(self.gui.CurrentContext().GetView()))
+		if ok {
+			return true, ""
+		}
+		return false, "Waiting for the rebase options menu to open on the 'continue' option"
+	})
 	self.Confirm()
 }
 
@@ -113,9 +244,29 @@ func (self *Input) ContinueRebase() {
 
 // for when you want to allow lazygit to process something before continuing
 func (self *Input) Wait(milliseconds int) {
+	if self.recorder != nil {
+		self.recorder.add(RecordedEvent{Kind: recordedEventWait, WaitMs: milliseconds})
+	}
+
 	time.Sleep(time.Duration(milliseconds) * time.Millisecond)
 }
 
+// bufferedView is satisfied by any view driver that can report its selected line and buffer
+type bufferedView interface {
+	SelectedLineIdx() int
+	ViewBufferLines() []string
+}
+
+// selectedLineContent returns the content of view's currently selected line, or "" if none
+func selectedLineContent(view bufferedView) string {
+	idx := view.SelectedLineIdx()
+	lines := view.ViewBufferLines()
+	if idx < 0 || idx >= len(lines) {
+		return ""
+	}
+	return lines[idx]
+}
+
 func (self *Input) LogUI(message string) {
 	self.gui.LogUI(message)
 }
@@ -124,64 +275,168 @@ func (self *Input) Log(message string) {
 	self.gui.LogUI(message)
 }
 
-// this will look for a list item in the current panel and if it finds it, it will
-// enter the keypresses required to navigate to it.
+// this will look for a list item anywhere in the current panel - not just on the currently
+// visible page - and if it finds it, it will enter the keypresses required to navigate to it.
 // The test will fail if:
 // - the user is not in a list item
-// - no list item is found containing the given text
-// - multiple list items are found containing the given text in the initial page of items
+// - no list item is found matching the given text anywhere in the list
+// - more than one list item matches the given text anywhere in the list
 //
-// NOTE: this currently assumes that ViewBufferLines returns all the lines that can be accessed.
-// If this changes in future, we'll need to update this code to first attempt to find the item
-// in the current page and failing that, jump to the top of the view and iterate through all of it,
-// looking for the item.
+// For matches that are expected to have legitimate duplicates, use NavigateToNthMatch instead.
 func (self *Input) NavigateToListItem(matcher *matcher) {
+	self.recordSemantic(RecordedEvent{Semantic: semanticNavigateToListItem, MatcherText: matcher.name})
+
 	self.assert.InListContext()
 
-	currentContext := self.gui.CurrentContext().(types.IListContext)
+	matchIndices := self.findAll(matcher)
+
+	if len(matchIndices) != 1 {
+		self.assert.Fail(fmt.Sprintf("Found %d matches for `%s`, expected exactly one. Use NavigateToNthMatch if duplicates are expected.", len(matchIndices), matcher.name))
+		return
+	}
+
+	self.navigateToAbsoluteIndex(matchIndices[0])
+	self.assert.SelectedLine(matcher)
+}
+
+// NavigateToNthMatch is like NavigateToListItem, but navigates to the n-th (1-indexed) match,
+// for cases where duplicate matches are legitimate and expected.
+func (self *Input) NavigateToNthMatch(matcher *matcher, n int) {
+	self.recordSemantic(RecordedEvent{Semantic: semanticNavigateToNthMatch, MatcherText: matcher.name, N: n})
 
-	view := currentContext.GetView()
+	self.assert.InListContext()
 
-	var matchIndex int
+	matchIndices := self.findAll(matcher)
 
-	self.assert.assertWithRetries(func() (bool, string) {
-		matchIndex = -1
-		var matches []string
-		// first we look for a duplicate on the current screen. We won't bother looking beyond that though.
-		for i, line := range view.ViewBufferLines() {
-			ok, _ := matcher.test(line)
-			if ok {
-				matches = append(matches, line)
-				matchIndex = i
+	if n < 1 || n > len(matchIndices) {
+		self.assert.Fail(fmt.Sprintf("Found %d matches for `%s`, expected at least %d", len(matchIndices), matcher.name, n))
+		return
+	}
+
+	self.navigateToAbsoluteIndex(matchIndices[n-1])
+	self.assert.SelectedLine(matcher)
+}
+
+// FindAll returns the absolute, zero-indexed line numbers of every line in the current list
+// context matching matcher. Unlike NavigateToListItem/NavigateToNthMatch it doesn't navigate
+// anywhere or fail on multiple matches.
+func (self *Input) FindAll(matcher *matcher) []int {
+	self.assert.InListContext()
+
+	return self.findAll(matcher)
+}
+
+// currentListView returns the view behind the panel currently in focus
+func (self *Input) currentListView() bufferedView {
+	return self.gui.CurrentContext().(types.IListContext).GetView()
+}
+
+// findAll pages from the top of the list to the bottom, accumulating every line matching matcher
+func (self *Input) findAll(matcher *matcher) []int {
+	view := self.currentListView()
+
+	var matchIndices []int
+	var lastPage []string
+	offset := 0
+
+	page := self.turnPage(self.keys.Universal.GotoTop, view)
+	for {
+		if samePage(page, lastPage) {
+			break
+		}
+
+		for i, line := range page {
+			if ok, _ := matcher.test(line); ok {
+				matchIndices = append(matchIndices, offset+i)
 			}
 		}
-		if len(matches) > 1 {
-			return false, fmt.Sprintf("Found %d matches for `%s`, expected only a single match. Lines:\n%s", len(matches), matcher.name, strings.Join(matches, "\n"))
-		} else if len(matches) == 0 {
-			return false, fmt.Sprintf("Could not find item matching: %s", matcher.name)
-		} else {
+
+		lastPage = page
+		offset += len(page)
+		page = self.turnPage(self.keys.Universal.NextPage, view)
+	}
+
+	return matchIndices
+}
+
+// navigateToAbsoluteIndex moves the selection to the given absolute, zero-indexed line (as
+// found by findAll), paging to the containing page and then stepping the rest of the way.
+func (self *Input) navigateToAbsoluteIndex(targetIdx int) {
+	view := self.currentListView()
+
+	var lastPage []string
+	offset := 0
+
+	page := self.turnPage(self.keys.Universal.GotoTop, view)
+	for {
+		if len(page) == 0 || offset+len(page) > targetIdx {
+			break
+		}
+		if samePage(page, lastPage) {
+			self.assert.Fail(fmt.Sprintf("NextPage did not advance the list while looking for line %d; the list may have changed since it was scanned", targetIdx))
+			return
+		}
+
+		lastPage = page
+		offset += len(page)
+		page = self.turnPage(self.keys.Universal.NextPage, view)
+	}
+
+	self.stepToLocalIndex(view, targetIdx-offset)
+}
+
+// turnPage presses keyStr (GotoTop or NextPage) and polls until view's buffer settles
+func (self *Input) turnPage(keyStr string, view bufferedView) []string {
+	var page []string
+	first := true
+
+	self.PressUntil(keyStr, func() (bool, string) {
+		current := view.ViewBufferLines()
+		if !first && samePage(current, page) {
 			return true, ""
 		}
+		page = current
+		first = false
+		return false, "waiting for view buffer to settle"
 	})
 
-	selectedLineIdx := view.SelectedLineIdx()
-	if selectedLineIdx == matchIndex {
-		self.assert.SelectedLine(matcher)
-		return
-	}
-	if selectedLineIdx < matchIndex {
-		for i := selectedLineIdx; i < matchIndex; i++ {
-			self.NextItem()
+	return page
+}
+
+// stepToLocalIndex moves the selection to targetIdx within the current page, one step at a time
+func (self *Input) stepToLocalIndex(view bufferedView, targetIdx int) {
+	for view.SelectedLineIdx() != targetIdx {
+		if view.SelectedLineIdx() < targetIdx {
+			expected := view.SelectedLineIdx() + 1
+			self.PressUntil(self.keys.Universal.NextItem, func() (bool, string) {
+				if view.SelectedLineIdx() == expected {
+					return true, ""
+				}
+				return false, fmt.Sprintf("waiting for selection to reach line %d", expected)
+			})
+		} else {
+			expected := view.SelectedLineIdx() - 1
+			self.PressUntil(self.keys.Universal.PrevItem, func() (bool, string) {
+				if view.SelectedLineIdx() == expected {
+					return true, ""
+				}
+				return false, fmt.Sprintf("waiting for selection to reach line %d", expected)
+			})
 		}
-		self.assert.SelectedLine(matcher)
-		return
-	} else {
-		for i := selectedLineIdx; i > matchIndex; i-- {
-			self.PreviousItem()
+	}
+}
+
+// samePage reports whether two consecutive reads of ViewBufferLines are identical
+func samePage(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-		self.assert.SelectedLine(matcher)
-		return
 	}
+	return true
 }
 
 func (self *Input) AcceptConfirmation(title *matcher, content *matcher) {
@@ -199,6 +454,8 @@ func (self *Input) DenyConfirmation(title *matcher, content *matcher) {
 }
 
 func (self *Input) Prompt(title *matcher, textToType string) {
+	self.recordSemantic(RecordedEvent{Semantic: semanticPrompt, TitleText: title.name, Text: textToType})
+
 	self.assert.InPrompt()
 	self.assert.CurrentViewTitle(title)
 	self.Type(textToType)
@@ -218,6 +475,8 @@ func (self *Input) Typeahead(title *matcher, textToType string, expectedFirstOpt
 }
 
 func (self *Input) Menu(title *matcher, optionToSelect *matcher) {
+	self.recordSemantic(RecordedEvent{Semantic: semanticMenu, TitleText: title.name, MatcherText: optionToSelect.name})
+
 	self.assert.InMenu()
 	self.assert.CurrentViewTitle(title)
 	self.NavigateToListItem(optionToSelect)
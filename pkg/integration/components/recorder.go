@@ -0,0 +1,77 @@
+package components
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// recordedEventKind distinguishes the kinds of interaction a recording session can capture
+type recordedEventKind string
+
+const (
+	recordedEventPress  recordedEventKind = "press"
+	recordedEventWait   recordedEventKind = "wait"
+	recordedEventAssert recordedEventKind = "assert"
+)
+
+// semanticKind names the Input helper that produced a recordedEventAssert entry
+type semanticKind string
+
+const (
+	semanticNavigateToListItem semanticKind = "navigateToListItem"
+	semanticNavigateToNthMatch semanticKind = "navigateToNthMatch"
+	semanticMenu               semanticKind = "menu"
+	semanticPrompt             semanticKind = "prompt"
+)
+
+// RecordedEvent is a single step captured while recording, timestamped relative to the start
+// of the recording. Semantic, MatcherText, TitleText, Text, and N are only set on
+// recordedEventAssert entries, and hold the original call's arguments for Replay to reconstruct it.
+type RecordedEvent struct {
+	Kind     recordedEventKind `json:"kind"`
+	OffsetMs int64             `json:"offsetMs"`
+	Key      string            `json:"key,omitempty"`
+	WaitMs   int               `json:"waitMs,omitempty"`
+
+	Semantic    semanticKind `json:"semantic,omitempty"`
+	MatcherText string       `json:"matcherText,omitempty"`
+	TitleText   string       `json:"titleText,omitempty"`
+	Text        string       `json:"text,omitempty"`
+	N           int          `json:"n,omitempty"`
+}
+
+// RecordedScript is the on-disk format produced by a recording session and consumed by Input.Replay
+type RecordedScript struct {
+	Events []RecordedEvent `json:"events"`
+}
+
+// recorder accumulates RecordedEvents and flushes the whole script to path after every one
+type recorder struct {
+	path      string
+	startedAt time.Time
+	events    []RecordedEvent
+}
+
+func newRecorder(path string) *recorder {
+	return &recorder{path: path, startedAt: time.Now()}
+}
+
+func (self *recorder) add(event RecordedEvent) {
+	event.OffsetMs = time.Since(self.startedAt).Milliseconds()
+	self.events = append(self.events, event)
+
+	// Best-effort: a failed write here shouldn't fail the test that's merely being recorded.
+	_ = self.flush()
+}
+
+func (self *recorder) flush() error {
+	script := RecordedScript{Events: self.events}
+
+	content, err := json.MarshalIndent(script, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(self.path, content, 0o644)
+}